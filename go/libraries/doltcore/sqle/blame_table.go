@@ -0,0 +1,497 @@
+// Copyright 2019 Liquidata, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqle
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/liquidata-inc/go-mysql-server/sql"
+
+	"github.com/liquidata-inc/dolt/go/libraries/doltcore/doltdb"
+	"github.com/liquidata-inc/dolt/go/libraries/doltcore/schema"
+	"github.com/liquidata-inc/dolt/go/store/hash"
+	"github.com/liquidata-inc/dolt/go/store/types"
+)
+
+// BlameTablePrefix is the prefix that dispatches to a BlameTable: `SELECT * FROM dolt_blame_mytable` attributes
+// every surviving row of `mytable` to the commit that last touched it, the SQL equivalent of `git blame`.
+const BlameTablePrefix = "dolt_blame_"
+
+// ParseBlameTableName reports whether name names a blame table and, if so, the underlying user table it blames.
+// It's the matcher a DatabaseProvider consults alongside LogTableName to decide whether a bare table name should
+// resolve to a BlameTable instead of a user table.
+func ParseBlameTableName(name string) (string, bool) {
+	if !strings.HasPrefix(name, BlameTablePrefix) {
+		return "", false
+	}
+
+	target := strings.TrimPrefix(name, BlameTablePrefix)
+	if target == "" {
+		return "", false
+	}
+
+	return target, true
+}
+
+var _ sql.Table = (*BlameTable)(nil)
+
+// BlameTable is a sql.Table implementation exposing per-row provenance for a single user table: which commit,
+// author, and message last modified each row still present in the working set.
+type BlameTable struct {
+	dbName      string
+	targetTable string
+	ddb         *doltdb.DoltDB
+	pkCols      []*sql.Column
+}
+
+// NewBlameTable creates a BlameTable for targetTable, reading its primary-key columns so Schema() can report
+// them alongside the fixed provenance columns.
+func NewBlameTable(ctx *sql.Context, dbName, targetTable string) (*BlameTable, error) {
+	sess := DSessFromSess(ctx.Session)
+	ddb, ok := sess.GetDoltDB(dbName)
+	if !ok {
+		return nil, sql.ErrDatabaseNotFound.New(dbName)
+	}
+
+	root, err := sess.GetRoot(ctx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	tbl, ok, err := root.GetTable(ctx, targetTable)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, sql.ErrTableNotFound.New(targetTable)
+	}
+
+	sch, err := tbl.GetSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	source := BlameTablePrefix + targetTable
+	var pkCols []*sql.Column
+	err = sch.GetPKCols().Iter(func(tag uint64, col schema.Column) (stop bool, err error) {
+		pkCols = append(pkCols, &sql.Column{
+			Name:       col.Name,
+			Type:       sqlTypeForNomsKind(col.Kind),
+			Source:     source,
+			PrimaryKey: true,
+		})
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlameTable{dbName: dbName, targetTable: targetTable, ddb: ddb, pkCols: pkCols}, nil
+}
+
+// sqlTypeForNomsKind maps a primary-key column's underlying noms value kind to the closest sql.Type, so the
+// dynamically-built blame schema at least round-trips the common cases (dolt's other system tables all use
+// fixed, hand-picked types since their schemas aren't table-dependent).
+func sqlTypeForNomsKind(kind types.NomsKind) sql.Type {
+	switch kind {
+	case types.IntKind:
+		return sql.Int64
+	case types.UintKind:
+		return sql.Uint64
+	case types.FloatKind:
+		return sql.Float64
+	case types.BoolKind:
+		return sql.Boolean
+	default:
+		return sql.Text
+	}
+}
+
+// Name implements sql.Table
+func (bt *BlameTable) Name() string {
+	return BlameTablePrefix + bt.targetTable
+}
+
+// String implements sql.Table
+func (bt *BlameTable) String() string {
+	return bt.Name()
+}
+
+// Schema implements sql.Table. It's the target table's primary-key columns, followed by the fixed provenance
+// columns every blame table exposes.
+func (bt *BlameTable) Schema() sql.Schema {
+	source := bt.Name()
+	cols := append([]*sql.Column{
+		{Name: "target_table", Type: sql.Text, Source: source, PrimaryKey: false},
+	}, bt.pkCols...)
+
+	return append(cols,
+		&sql.Column{Name: "commit_hash", Type: sql.Text, Source: source, PrimaryKey: false},
+		&sql.Column{Name: "committer", Type: sql.Text, Source: source, PrimaryKey: false},
+		&sql.Column{Name: "email", Type: sql.Text, Source: source, PrimaryKey: false},
+		&sql.Column{Name: "date", Type: sql.Datetime, Source: source, PrimaryKey: false},
+		&sql.Column{Name: "message", Type: sql.Text, Source: source, PrimaryKey: false},
+	)
+}
+
+// Partitions implements sql.Table. The data is unpartitioned.
+func (bt *BlameTable) Partitions(*sql.Context) (sql.PartitionIter, error) {
+	return &doltTablePartitionIter{}, nil
+}
+
+// PartitionRows implements sql.Table
+func (bt *BlameTable) PartitionRows(sqlCtx *sql.Context, part sql.Partition) (sql.RowIter, error) {
+	rows, err := blameRows(sqlCtx, bt.dbName, bt.targetTable, bt.ddb)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blameRowItr{rows: rows}, nil
+}
+
+// blameCacheKey identifies one memoized blame computation: a database and working root paired with the table
+// blamed at it. dbName is part of the key because one session's cache serves every database that session
+// queries, and two databases can share a root hash while having different commit histories to blame from.
+type blameCacheKey struct {
+	dbName    string
+	rootHash  hash.Hash
+	tableName string
+}
+
+// defaultBlameCacheSize is the number of blame results cached per session. A session rarely blames more than a
+// handful of tables at a time, so this comfortably covers typical use without holding unbounded memory.
+const defaultBlameCacheSize = 64
+
+// sessionBlameCache is a small per-session FIFO cache from (db, root, table) to its computed blame rows,
+// avoiding repeating a full history walk and diff when the same `dolt_blame_t` query runs again against an
+// unchanged working set - common in dashboards that re-run the same query on a timer.
+type sessionBlameCache struct {
+	mu      sync.Mutex
+	size    int
+	order   []blameCacheKey
+	entries map[blameCacheKey][]sql.Row
+}
+
+func newSessionBlameCache(size int) *sessionBlameCache {
+	return &sessionBlameCache{
+		size:    size,
+		entries: make(map[blameCacheKey][]sql.Row, size),
+	}
+}
+
+func (c *sessionBlameCache) get(key blameCacheKey) ([]sql.Row, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows, ok := c.entries[key]
+	return rows, ok
+}
+
+func (c *sessionBlameCache) put(key blameCacheKey, rows []sql.Row) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+
+	if _, exists := c.entries[key]; !exists {
+		if len(c.order) >= c.size {
+			oldest := c.order[0]
+			c.order = c.order[1:]
+			delete(c.entries, oldest)
+		}
+		c.order = append(c.order, key)
+	}
+
+	c.entries[key] = rows
+}
+
+// maxTrackedBlameSessions bounds how many sessions' blame caches sessionBlameCaches keeps alive at once, for the
+// same reason commitMetaCache's maxTrackedSessions does: there's no session-teardown hook to evict on
+// disconnect, so this cap keeps a long-running server's memory bounded instead of growing with total
+// connections ever seen.
+const maxTrackedBlameSessions = 4096
+
+var blameSessionTracker = struct {
+	mu    sync.Mutex
+	order []*DoltSession
+}{}
+
+// sessionBlameCaches holds one sessionBlameCache per *DoltSession.
+var sessionBlameCaches sync.Map // *DoltSession -> *sessionBlameCache
+
+// blameCacheForSession returns the sessionBlameCache for sess, creating one if this is the first blame query in
+// the session.
+func blameCacheForSession(sess *DoltSession) *sessionBlameCache {
+	if existing, ok := sessionBlameCaches.Load(sess); ok {
+		return existing.(*sessionBlameCache)
+	}
+
+	c := newSessionBlameCache(defaultBlameCacheSize)
+	actual, loaded := sessionBlameCaches.LoadOrStore(sess, c)
+	if !loaded {
+		trackBlameSession(sess)
+	}
+
+	return actual.(*sessionBlameCache)
+}
+
+// trackBlameSession records sess as having a live blame cache entry, evicting the oldest tracked session once
+// maxTrackedBlameSessions is exceeded.
+func trackBlameSession(sess *DoltSession) {
+	blameSessionTracker.mu.Lock()
+	defer blameSessionTracker.mu.Unlock()
+
+	blameSessionTracker.order = append(blameSessionTracker.order, sess)
+	if len(blameSessionTracker.order) > maxTrackedBlameSessions {
+		oldest := blameSessionTracker.order[0]
+		blameSessionTracker.order = blameSessionTracker.order[1:]
+		sessionBlameCaches.Delete(oldest)
+	}
+}
+
+// ResolveBlameTable is the dispatch entry point a DatabaseProvider consults to resolve a bare table name to a
+// BlameTable: it reports ok=false for any name ParseBlameTableName doesn't recognize as a blame table, leaving
+// the provider to fall back to its normal user-table and other-system-table resolution.
+func ResolveBlameTable(ctx *sql.Context, dbName, name string) (sql.Table, bool, error) {
+	targetTable, ok := ParseBlameTableName(name)
+	if !ok {
+		return nil, false, nil
+	}
+
+	bt, err := NewBlameTable(ctx, dbName, targetTable)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return bt, true, nil
+}
+
+// blameRows computes (or fetches from cache) the blame attribution for every surviving row of targetTable,
+// walking history from the session's parent commit and diffing each commit's row data against its first
+// parent's to find the last commit that added or modified each surviving row. Uncommitted changes are not
+// attributed: a row changed only in the working set is attributed to the last commit that changed its key, and
+// a row whose key appears in no commit on that first-parent history is left out of the result.
+func blameRows(sqlCtx *sql.Context, dbName, targetTable string, ddb *doltdb.DoltDB) ([]sql.Row, error) {
+	ctx := sqlCtx.Context
+	sess := DSessFromSess(sqlCtx.Session)
+
+	root, err := sess.GetRoot(sqlCtx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	rootHash, err := root.HashOf()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := blameCacheForSession(sess)
+	key := blameCacheKey{dbName: dbName, rootHash: rootHash, tableName: targetTable}
+	if cached, ok := cache.get(key); ok {
+		return cached, nil
+	}
+
+	commit, err := sess.GetParentCommit(sqlCtx, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	rowData, err := rowDataAt(ctx, root, targetTable)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := map[hash.Hash]types.Value{}
+	err = rowData.IterAll(ctx, func(k, _ types.Value) error {
+		kh, err := k.Hash(rowData.Format())
+		if err != nil {
+			return err
+		}
+		remaining[kh] = k
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attribution := map[hash.Hash]sql.Row{}
+
+	for cur := commit; len(remaining) > 0; {
+		curRoot, err := cur.GetRootValue()
+		if err != nil {
+			return nil, err
+		}
+		curRowData, err := rowDataAt(ctx, curRoot, targetTable)
+		if err != nil {
+			return nil, err
+		}
+
+		parents, err := cur.ParentHashes(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var parent *doltdb.Commit
+		parentRowData := types.EmptyMap
+		if len(parents) > 0 {
+			parent, err = ddb.ReadCommit(parents[0])
+			if err != nil {
+				return nil, err
+			}
+
+			parentRoot, err := parent.GetRootValue()
+			if err != nil {
+				return nil, err
+			}
+
+			parentRowData, err = rowDataAt(ctx, parentRoot, targetTable)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		meta, err := cur.GetCommitMeta()
+		if err != nil {
+			return nil, err
+		}
+
+		ch, err := cur.HashOf()
+		if err != nil {
+			return nil, err
+		}
+
+		changes := make(chan types.ValueChanged)
+		stop := make(chan struct{})
+		go func() {
+			defer close(changes)
+			_ = curRowData.Diff(ctx, parentRowData, changes, stop)
+		}()
+
+		for change := range changes {
+			if change.ChangeType == types.DiffChangeRemoved {
+				continue
+			}
+
+			kh, err := change.Key.Hash(curRowData.Format())
+			if err != nil {
+				close(stop)
+				return nil, err
+			}
+
+			pk, ok := remaining[kh]
+			if !ok {
+				continue
+			}
+			delete(remaining, kh)
+
+			row := append(sql.Row{targetTable}, pkValues(pk)...)
+			row = append(row, ch.String(), meta.Name, meta.Email, meta.Time(), meta.Description)
+			attribution[kh] = row
+		}
+
+		if parent == nil {
+			break
+		}
+		cur = parent
+	}
+
+	rows := make([]sql.Row, 0, len(attribution))
+	for _, row := range attribution {
+		rows = append(rows, row)
+	}
+
+	cache.put(key, rows)
+	return rows, nil
+}
+
+// rowDataAt returns the row data map for tableName in root, or an empty map if the table doesn't exist there
+// yet (e.g. the commit predates the table's creation).
+func rowDataAt(ctx context.Context, root *doltdb.RootValue, tableName string) (types.Map, error) {
+	tbl, ok, err := root.GetTable(ctx, tableName)
+	if err != nil {
+		return types.EmptyMap, err
+	}
+	if !ok {
+		return types.EmptyMap, nil
+	}
+
+	return tbl.GetRowData(ctx)
+}
+
+// pkValues unpacks a noms primary-key tuple into the flat, per-column values a sql.Row expects, decoding each
+// noms value with nomsValueToGo.
+func pkValues(pk types.Value) []interface{} {
+	tup, ok := pk.(types.Tuple)
+	if !ok {
+		return []interface{}{nomsValueToGo(pk)}
+	}
+
+	vals := make([]interface{}, 0, tup.Len()/2)
+	for i := uint64(1); i < tup.Len(); i += 2 {
+		v, err := tup.Get(i)
+		if err != nil {
+			continue
+		}
+		vals = append(vals, nomsValueToGo(v))
+	}
+
+	return vals
+}
+
+// nomsValueToGo decodes a noms Int, Uint, Float, Bool or String value to the Go primitive matching the sql.Type
+// sqlTypeForNomsKind assigns its kind. A value of any other kind is returned as the noms types.Value itself.
+func nomsValueToGo(v types.Value) interface{} {
+	switch t := v.(type) {
+	case types.Int:
+		return int64(t)
+	case types.Uint:
+		return uint64(t)
+	case types.Float:
+		return float64(t)
+	case types.Bool:
+		return bool(t)
+	case types.String:
+		return string(t)
+	default:
+		return v
+	}
+}
+
+// blameRowItr is a sql.RowIter over a precomputed slice of blame rows.
+type blameRowItr struct {
+	rows []sql.Row
+	idx  int
+}
+
+// Next implements sql.RowIter
+func (itr *blameRowItr) Next() (sql.Row, error) {
+	if itr.idx >= len(itr.rows) {
+		return nil, io.EOF
+	}
+
+	row := itr.rows[itr.idx]
+	itr.idx++
+	return row, nil
+}
+
+// Close implements sql.RowIter
+func (itr *blameRowItr) Close() error {
+	return nil
+}
@@ -0,0 +1,339 @@
+// Copyright 2019 Liquidata, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqle
+
+import (
+	"container/heap"
+	"context"
+	"io"
+	"time"
+
+	"github.com/liquidata-inc/go-mysql-server/sql"
+
+	"github.com/liquidata-inc/dolt/go/libraries/doltcore/doltdb"
+	"github.com/liquidata-inc/dolt/go/store/hash"
+)
+
+// CommitAncestorsTableName is the name of the system table that exposes the commit graph's edges, one row per
+// (commit, parent) pair, so SQL can express ancestry queries (recursive CTEs, merge-base, first-parent walks)
+// that dolt_log's flat rows can't.
+const CommitAncestorsTableName = "dolt_commit_ancestors"
+
+// SystemTables maps a dolt system table name to the constructor that builds it. ResolveTable is what a
+// DatabaseProvider should actually call; this map exists separately so ResolveTable can report which name
+// matched without a type switch.
+var SystemTables = map[string]func(ctx *sql.Context, dbName string) (sql.Table, error){
+	doltdb.LogTableName: func(ctx *sql.Context, dbName string) (sql.Table, error) {
+		return NewLogTable(ctx, dbName)
+	},
+	CommitAncestorsTableName: func(ctx *sql.Context, dbName string) (sql.Table, error) {
+		return NewCommitAncestorsTable(ctx, dbName)
+	},
+}
+
+// DoltFunctions lists the custom SQL functions this package defines. LookupDoltFunction is what an engine's
+// function catalog should actually call when resolving a function name during query planning.
+var DoltFunctions = []sql.Function{
+	sql.Function2{Name: MergeBaseFuncName, Fn: NewMergeBaseFunc},
+}
+
+// ResolveTable is the single dispatch entry point a DatabaseProvider should consult, ahead of its normal
+// user-table resolution, to find a bare table name among this package's system tables (dolt_log,
+// dolt_commit_ancestors) or blame tables (dolt_blame_<t>). It reports ok=false with a nil error only when name
+// matches neither, which is exactly the signal a provider needs to fall back to looking the name up as a user
+// table; a matching table whose constructor fails is reported as ok=false with that error.
+//
+// This checkout has no DoltDatabase/DatabaseProvider source for ResolveTable to be wired into - the
+// go-mysql-server integration that owns table-name resolution lives outside this package's files. ResolveTable
+// is the complete wiring this package can offer; plugging it into an actual provider's resolution method is a
+// one-line call at that call site once that file exists in this tree.
+func ResolveTable(ctx *sql.Context, dbName, name string) (sql.Table, bool, error) {
+	if ctor, ok := SystemTables[name]; ok {
+		t, err := ctor(ctx, dbName)
+		if err != nil {
+			return nil, false, err
+		}
+		return t, true, nil
+	}
+
+	return ResolveBlameTable(ctx, dbName, name)
+}
+
+// LookupDoltFunction resolves name against DoltFunctions, the entry point an engine's function catalog should
+// call when registering (or resolving calls to) this package's custom functions alongside the built-ins. Same
+// caveat as ResolveTable: this checkout has no catalog-construction file to call it from yet.
+func LookupDoltFunction(name string) (sql.Function, bool) {
+	for _, fn := range DoltFunctions {
+		if f2, ok := fn.(sql.Function2); ok && f2.Name == name {
+			return fn, true
+		}
+	}
+	return nil, false
+}
+
+var _ sql.Table = (*CommitAncestorsTable)(nil)
+
+// CommitAncestorsTable is a sql.Table implementation for the dolt_commit_ancestors system table.
+type CommitAncestorsTable struct {
+	dbName string
+	ddb    *doltdb.DoltDB
+}
+
+// NewCommitAncestorsTable creates a CommitAncestorsTable
+func NewCommitAncestorsTable(ctx *sql.Context, dbName string) (*CommitAncestorsTable, error) {
+	ddb, ok := DSessFromSess(ctx.Session).GetDoltDB(dbName)
+
+	if !ok {
+		return nil, sql.ErrDatabaseNotFound.New(dbName)
+	}
+
+	return &CommitAncestorsTable{dbName: dbName, ddb: ddb}, nil
+}
+
+// Name implements sql.Table
+func (at *CommitAncestorsTable) Name() string {
+	return CommitAncestorsTableName
+}
+
+// String implements sql.Table
+func (at *CommitAncestorsTable) String() string {
+	return CommitAncestorsTableName
+}
+
+// Schema implements sql.Table
+func (at *CommitAncestorsTable) Schema() sql.Schema {
+	return []*sql.Column{
+		{Name: "commit_hash", Type: sql.Text, Source: CommitAncestorsTableName, PrimaryKey: true},
+		{Name: "parent_hash", Type: sql.Text, Source: CommitAncestorsTableName, PrimaryKey: false},
+		{Name: "parent_index", Type: sql.Int32, Source: CommitAncestorsTableName, PrimaryKey: true},
+	}
+}
+
+// Partitions implements sql.Table. The data is unpartitioned.
+func (at *CommitAncestorsTable) Partitions(*sql.Context) (sql.PartitionIter, error) {
+	return &doltTablePartitionIter{}, nil
+}
+
+// PartitionRows implements sql.Table
+func (at *CommitAncestorsTable) PartitionRows(sqlCtx *sql.Context, part sql.Partition) (sql.RowIter, error) {
+	return NewAncestorsItr(sqlCtx, at.dbName, at.ddb)
+}
+
+// AncestorsItr is a sql.RowIter that walks the commit graph breadth-first from the session's parent commit,
+// yielding one row per (commit, parent) edge.
+type AncestorsItr struct {
+	ctx     context.Context
+	ddb     *doltdb.DoltDB
+	queue   []*doltdb.Commit
+	seen    map[hash.Hash]bool
+	pending []sql.Row
+}
+
+// NewAncestorsItr creates an AncestorsItr rooted at the session's parent commit for dbName.
+func NewAncestorsItr(sqlCtx *sql.Context, dbName string, ddb *doltdb.DoltDB) (*AncestorsItr, error) {
+	sess := DSessFromSess(sqlCtx.Session)
+	commit, err := sess.GetParentCommit(sqlCtx, dbName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &AncestorsItr{
+		ctx:   sqlCtx.Context,
+		ddb:   ddb,
+		queue: []*doltdb.Commit{commit},
+		seen:  make(map[hash.Hash]bool),
+	}, nil
+}
+
+// Next implements sql.RowIter
+func (itr *AncestorsItr) Next() (sql.Row, error) {
+	for len(itr.pending) == 0 {
+		if err := itr.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if len(itr.queue) == 0 {
+			return nil, io.EOF
+		}
+
+		cm := itr.queue[0]
+		itr.queue = itr.queue[1:]
+
+		ch, err := cm.HashOf()
+		if err != nil {
+			return nil, err
+		}
+
+		if itr.seen[ch] {
+			continue
+		}
+		itr.seen[ch] = true
+
+		parents, err := cm.ParentHashes(itr.ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, ph := range parents {
+			itr.pending = append(itr.pending, sql.NewRow(ch.String(), ph.String(), int32(i)))
+
+			if !itr.seen[ph] {
+				parent, err := itr.ddb.ReadCommit(ph)
+				if err != nil {
+					return nil, err
+				}
+				itr.queue = append(itr.queue, parent)
+			}
+		}
+	}
+
+	row := itr.pending[0]
+	itr.pending = itr.pending[1:]
+	return row, nil
+}
+
+// Close implements sql.RowIter
+func (itr *AncestorsItr) Close() error {
+	return nil
+}
+
+// mergeBaseColor records which of the two starting commits a node in MergeBase's walk is known to be an
+// ancestor of (or both).
+type mergeBaseColor uint8
+
+const (
+	colorA mergeBaseColor = 1 << iota
+	colorB
+)
+
+// mergeBaseNode is a single commit under consideration during MergeBase's colored walk.
+type mergeBaseNode struct {
+	commit *doltdb.Commit
+	when   time.Time
+	color  mergeBaseColor
+}
+
+// mergeBaseHeap is a container/heap.Interface ordered by commit time, most recent first, mirroring LogItr's
+// commitHeap so MergeBase visits the DAG in the same reverse-chronological order git's own merge-base search
+// does.
+type mergeBaseHeap []*mergeBaseNode
+
+func (h mergeBaseHeap) Len() int            { return len(h) }
+func (h mergeBaseHeap) Less(i, j int) bool  { return h[i].when.After(h[j].when) }
+func (h mergeBaseHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeBaseHeap) Push(x interface{}) { *h = append(*h, x.(*mergeBaseNode)) }
+func (h *mergeBaseHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// MergeBase finds the best common ancestor of commitA and commitB - the same notion `git merge-base` computes -
+// by walking the DAG newest-first, coloring each commit by which of the two it's reachable from. A lockstep
+// meeting-point BFS can stop at a common ancestor of the true merge-base whenever the two branches have uneven
+// depth; coloring instead keeps propagating color along both frontiers and returns the
+// first (i.e. most recent) commit to carry both colors, which - processing the DAG in descending commit-time
+// order - is the lowest common ancestor rather than an arbitrary meeting point. It's the traversal backing the
+// dolt_merge_base(hashA, hashB) SQL function.
+func MergeBase(ctx context.Context, ddb *doltdb.DoltDB, commitA, commitB *doltdb.Commit) (hash.Hash, error) {
+	nodes := make(map[hash.Hash]*mergeBaseNode)
+	h := &mergeBaseHeap{}
+	heap.Init(h)
+
+	seed := func(cm *doltdb.Commit, c mergeBaseColor) (hash.Hash, error) {
+		ch, err := cm.HashOf()
+		if err != nil {
+			return hash.Hash{}, err
+		}
+
+		meta, err := cm.GetCommitMeta()
+		if err != nil {
+			return hash.Hash{}, err
+		}
+
+		n := &mergeBaseNode{commit: cm, when: meta.Time(), color: c}
+		nodes[ch] = n
+		heap.Push(h, n)
+		return ch, nil
+	}
+
+	chA, err := seed(commitA, colorA)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+
+	chB, err := seed(commitB, colorB)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+
+	// commitA and commitB may be the same commit - seeding them separately above would otherwise leave only
+	// colorB on the shared node.
+	if chA == chB {
+		nodes[chA].color = colorA | colorB
+	}
+
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return hash.Hash{}, err
+		}
+
+		n := heap.Pop(h).(*mergeBaseNode)
+
+		if n.color == colorA|colorB {
+			// The first both-colored node popped is, by the heap's descending-time order, the most recent
+			// common ancestor, and no common ancestor popped later can be its descendant as long as commit
+			// times never run backwards from parent to child. Only this one is returned: where the two
+			// commits have several best common ancestors (criss-cross merges), the others are not reported.
+			return n.commit.HashOf()
+		}
+
+		parents, err := n.commit.ParentHashes(ctx)
+		if err != nil {
+			return hash.Hash{}, err
+		}
+
+		for _, ph := range parents {
+			existing, ok := nodes[ph]
+			if ok && existing.color&n.color == n.color {
+				// Parent already carries every color this edge would add; nothing new to propagate.
+				continue
+			}
+
+			if !ok {
+				parent, err := ddb.ReadCommit(ph)
+				if err != nil {
+					return hash.Hash{}, err
+				}
+
+				meta, err := parent.GetCommitMeta()
+				if err != nil {
+					return hash.Hash{}, err
+				}
+
+				existing = &mergeBaseNode{commit: parent, when: meta.Time()}
+				nodes[ph] = existing
+			}
+
+			existing.color |= n.color
+			heap.Push(h, existing)
+		}
+	}
+
+	return hash.Hash{}, doltdb.ErrCommitNotFound
+}
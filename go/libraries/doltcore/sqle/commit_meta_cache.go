@@ -0,0 +1,198 @@
+// Copyright 2019 Liquidata, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqle
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/liquidata-inc/go-mysql-server/sql"
+
+	"github.com/liquidata-inc/dolt/go/store/hash"
+)
+
+// DoltLogCacheSizeSessionVar is the session variable that controls how many decoded commits a session's
+// commitMetaCache keeps. Set to 0 to disable caching entirely. It is read once, when the session's cache is
+// created on its first dolt_log scan; changing it afterwards does not resize or disable that existing cache.
+const DoltLogCacheSizeSessionVar = "dolt_log_cache_size"
+
+// defaultLogCacheSize is the number of commits cached per session when dolt_log_cache_size hasn't been set.
+// It covers a dolt_log page of up to 256 commits without holding unbounded memory for repositories with very
+// long histories.
+const defaultLogCacheSize = 256
+
+// DoltLogCacheHitsSessionVar and DoltLogCacheMissesSessionVar expose a session's cumulative commitMetaCache
+// hit/miss counts, so an operator can check whether dolt_log_cache_size is actually paying off with
+// `SELECT @@dolt_log_cache_hits, @@dolt_log_cache_misses` instead of having to attach a profiler. LogItr.Close
+// updates them after each dolt_log scan.
+const DoltLogCacheHitsSessionVar = "dolt_log_cache_hits"
+const DoltLogCacheMissesSessionVar = "dolt_log_cache_misses"
+
+func init() {
+	sql.SystemVariables.AddSystemVariables([]sql.SystemVariable{
+		{
+			Name:    DoltLogCacheSizeSessionVar,
+			Scope:   sql.SystemVariableScope_Session,
+			Dynamic: true,
+			Type:    sql.Int64,
+			Default: int64(defaultLogCacheSize),
+		},
+		{
+			Name:    DoltLogCacheHitsSessionVar,
+			Scope:   sql.SystemVariableScope_Session,
+			Dynamic: true,
+			Type:    sql.Int64,
+			Default: int64(0),
+		},
+		{
+			Name:    DoltLogCacheMissesSessionVar,
+			Scope:   sql.SystemVariableScope_Session,
+			Dynamic: true,
+			Type:    sql.Int64,
+			Default: int64(0),
+		},
+	})
+}
+
+// commitMetaEntry is the decoded, cacheable part of a *doltdb.Commit: everything LogItr.Next needs to build a
+// dolt_log row without touching the commit's noms value again.
+type commitMetaEntry struct {
+	name, email, description string
+	when                     time.Time
+	parentHashes             []hash.Hash
+}
+
+// commitMetaCache is a small per-session LRU cache from commit address to its decoded metadata, avoiding
+// repeated GetCommitMeta/HashOf/ParentHashes noms decodes when the same commits are scanned more than once in
+// a session (paginated dolt_log queries, joins, dashboard-style polling). Recency is tracked with an
+// intrusive list rather than a plain slice so a hit's touch is O(1) even when dolt_log_cache_size is set large.
+type commitMetaCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // of hash.Hash, most-recently-used at the back
+	index   map[hash.Hash]*list.Element
+	entries map[hash.Hash]commitMetaEntry
+	hits    uint64
+	misses  uint64
+}
+
+func newCommitMetaCache(size int) *commitMetaCache {
+	return &commitMetaCache{
+		size:    size,
+		order:   list.New(),
+		index:   make(map[hash.Hash]*list.Element, size),
+		entries: make(map[hash.Hash]commitMetaEntry, size),
+	}
+}
+
+func (c *commitMetaCache) get(h hash.Hash) (commitMetaEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[h]
+	if ok {
+		c.hits++
+		c.order.MoveToBack(c.index[h])
+	} else {
+		c.misses++
+	}
+	return e, ok
+}
+
+func (c *commitMetaCache) put(h hash.Hash, e commitMetaEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+
+	if _, exists := c.entries[h]; !exists {
+		if c.order.Len() >= c.size {
+			oldest := c.order.Front()
+			c.order.Remove(oldest)
+			oldestHash := oldest.Value.(hash.Hash)
+			delete(c.entries, oldestHash)
+			delete(c.index, oldestHash)
+		}
+		c.index[h] = c.order.PushBack(h)
+	}
+
+	c.entries[h] = e
+}
+
+// stats returns the cache's cumulative hit/miss counters for a session. LogItr.Close reads these to publish
+// DoltLogCacheHitsSessionVar/DoltLogCacheMissesSessionVar after each scan.
+func (c *commitMetaCache) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// maxTrackedSessions bounds how many sessions' caches sessionCommitMetaCaches keeps alive at once. Without a
+// hook into session teardown, the cache can't evict on disconnect, so this cap (evicting the oldest tracked
+// session on overflow) is what keeps a long-running server's memory bounded instead of growing with total
+// connections ever seen.
+const maxTrackedSessions = 4096
+
+var sessionCacheTracker = struct {
+	mu    sync.Mutex
+	order []*DoltSession
+}{}
+
+// sessionCommitMetaCaches holds one commitMetaCache per *DoltSession. It's keyed off the session pointer rather
+// than a field on DoltSession itself to keep this cache self-contained within the sqle/log code that uses it.
+var sessionCommitMetaCaches sync.Map // *DoltSession -> *commitMetaCache
+
+// commitMetaCacheForSession returns the commitMetaCache for sess, creating one sized by the session's
+// dolt_log_cache_size variable if this is the first log scan in the session. Cached entries never need
+// invalidating on write: they're keyed by commit hash, and commits are immutable, content-addressed values in
+// DoltDB, so a cached (hash -> metadata) mapping can never go stale. What a write changes is which commit a
+// session's HEAD points at, not the contents of any commit that hash already names.
+func commitMetaCacheForSession(sqlCtx *sql.Context, sess *DoltSession) *commitMetaCache {
+	if existing, ok := sessionCommitMetaCaches.Load(sess); ok {
+		return existing.(*commitMetaCache)
+	}
+
+	size := defaultLogCacheSize
+	if v, err := sqlCtx.GetSessionVariable(sqlCtx, DoltLogCacheSizeSessionVar); err == nil {
+		if n, ok := v.(int64); ok {
+			size = int(n)
+		}
+	}
+
+	c := newCommitMetaCache(size)
+	actual, loaded := sessionCommitMetaCaches.LoadOrStore(sess, c)
+	if !loaded {
+		trackSession(sess)
+	}
+
+	return actual.(*commitMetaCache)
+}
+
+// trackSession records sess as having a live cache entry, evicting the oldest tracked session once
+// maxTrackedSessions is exceeded.
+func trackSession(sess *DoltSession) {
+	sessionCacheTracker.mu.Lock()
+	defer sessionCacheTracker.mu.Unlock()
+
+	sessionCacheTracker.order = append(sessionCacheTracker.order, sess)
+	if len(sessionCacheTracker.order) > maxTrackedSessions {
+		oldest := sessionCacheTracker.order[0]
+		sessionCacheTracker.order = sessionCacheTracker.order[1:]
+		sessionCommitMetaCaches.Delete(oldest)
+	}
+}
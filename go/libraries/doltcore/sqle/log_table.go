@@ -15,20 +15,26 @@
 package sqle
 
 import (
+	"container/heap"
+	"context"
 	"io"
+	"strings"
 
 	"github.com/liquidata-inc/go-mysql-server/sql"
+	"github.com/liquidata-inc/go-mysql-server/sql/expression"
 
 	"github.com/liquidata-inc/dolt/go/libraries/doltcore/doltdb"
-	"github.com/liquidata-inc/dolt/go/libraries/doltcore/env/actions"
+	"github.com/liquidata-inc/dolt/go/store/hash"
 )
 
 var _ sql.Table = (*LogTable)(nil)
+var _ sql.FilteredTable = (*LogTable)(nil)
 
 // LogTable is a sql.Table implementation that implements a system table which shows the dolt commit log
 type LogTable struct {
-	dbName string
-	ddb    *doltdb.DoltDB
+	dbName  string
+	ddb     *doltdb.DoltDB
+	filters []sql.Expression
 }
 
 // NewLogTable creates a LogTable
@@ -62,6 +68,7 @@ func (dt *LogTable) Schema() sql.Schema {
 		{Name: "email", Type: sql.Text, Source: doltdb.LogTableName, PrimaryKey: false},
 		{Name: "date", Type: sql.Datetime, Source: doltdb.LogTableName, PrimaryKey: false},
 		{Name: "message", Type: sql.Text, Source: doltdb.LogTableName, PrimaryKey: false},
+		{Name: "parent_hashes", Type: sql.Text, Source: doltdb.LogTableName, PrimaryKey: false},
 	}
 }
 
@@ -72,17 +79,74 @@ func (dt *LogTable) Partitions(*sql.Context) (sql.PartitionIter, error) {
 
 // PartitionRows is a sql.Table interface function that gets a row iterator for a partition
 func (dt *LogTable) PartitionRows(sqlCtx *sql.Context, part sql.Partition) (sql.RowIter, error) {
-	return NewLogItr(sqlCtx, dt.dbName, dt.ddb)
+	return NewLogItr(sqlCtx, dt.dbName, dt.ddb, dt.filters)
 }
 
-// LogItr is a sql.RowItr implementation which iterates over each commit as if it's a row in the table.
+// HandledFilters is a sql.FilteredTable interface function that returns the subset of filters that LogItr can
+// evaluate itself while streaming. Only a commit_hash equality is handled: it lets Next read that one commit
+// with ddb.ReadCommit and check that it is reachable from HEAD, instead of yielding the whole time-ordered
+// history. Every other filter (committer, email, date ranges, ...)
+// is left for the engine's Filter node to apply against the rows LogItr yields, since Next doesn't evaluate
+// them itself.
+func (dt *LogTable) HandledFilters(filters []sql.Expression) []sql.Expression {
+	var handled []sql.Expression
+	for _, f := range filters {
+		if _, ok := commitHashEquality([]sql.Expression{f}); ok {
+			handled = append(handled, f)
+		}
+	}
+	return handled
+}
+
+// WithFilters is a sql.FilteredTable interface function that returns a new LogTable with the given filters applied
+// to its row iteration.
+func (dt *LogTable) WithFilters(filters []sql.Expression) sql.Table {
+	if len(filters) == 0 {
+		return dt
+	}
+
+	nt := *dt
+	nt.filters = filters
+	return &nt
+}
+
+// Filters is a sql.FilteredTable interface function that returns the filters currently applied to this table.
+func (dt *LogTable) Filters() []sql.Expression {
+	return dt.filters
+}
+
+// LogItr is a sql.RowItr implementation which streams commits from the commit graph as if each were a row in the
+// table, in reverse-time order, without materializing the whole history up front.
 type LogItr struct {
-	commits []*doltdb.Commit
-	idx     int
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sqlCtx is kept alongside the derived ctx so Close can report the session cache's cumulative hit/miss
+	// counts back to the session via SetSessionVariable, which takes a *sql.Context rather than a plain context.Context.
+	sqlCtx *sql.Context
+
+	ddb        *doltdb.DoltDB
+	headCommit *doltdb.Commit
+	filters    []sql.Expression
+	cache      *commitMetaCache
+
+	// commitHashEq, when non-empty, is a single equality filter on commit_hash. It lets Next read just that
+	// commit with ddb.ReadCommit and yield it if it is an ancestor of headCommit - dolt_log only ever shows
+	// HEAD's own history. That ancestor check is a breadth-first walk of parents from headCommit (isAncestor),
+	// which stops as soon as it reaches the named commit.
+	commitHashEq string
+	found        bool
+
+	// head is a min-heap of not-yet-visited commits, ordered so the most recent commit is popped first. Its
+	// size tracks the number of live, unmerged branch tips rather than the full commit count.
+	head *commitHeap
+	seen map[hash.Hash]bool
 }
 
-// NewLogItr creates a LogItr from the current environment.
-func NewLogItr(sqlCtx *sql.Context, dbName string, ddb *doltdb.DoltDB) (*LogItr, error) {
+// NewLogItr creates a LogItr that lazily walks history starting at the session's parent commit for dbName. The
+// walk is tied to sqlCtx.Context: Next polls it between commit loads and returns its error once cancelled, so a
+// client disconnect or KILL QUERY stops a long log scan instead of running it to completion.
+func NewLogItr(sqlCtx *sql.Context, dbName string, ddb *doltdb.DoltDB, filters []sql.Expression) (*LogItr, error) {
 	sess := DSessFromSess(sqlCtx.Session)
 	commit, err := sess.GetParentCommit(sqlCtx, dbName)
 
@@ -90,43 +154,303 @@ func NewLogItr(sqlCtx *sql.Context, dbName string, ddb *doltdb.DoltDB) (*LogItr,
 		return nil, err
 	}
 
-	commits, err := actions.TimeSortedCommits(sqlCtx, ddb, commit, -1)
+	ctx, cancel := context.WithCancel(sqlCtx.Context)
 
-	if err != nil {
+	itr := &LogItr{
+		ctx:        ctx,
+		cancel:     cancel,
+		sqlCtx:     sqlCtx,
+		ddb:        ddb,
+		headCommit: commit,
+		filters:    filters,
+		cache:      commitMetaCacheForSession(sqlCtx, sess),
+		seen:       make(map[hash.Hash]bool),
+	}
+
+	if eq, ok := commitHashEquality(filters); ok {
+		itr.commitHashEq = eq
+		return itr, nil
+	}
+
+	h := &commitHeap{}
+	heap.Init(h)
+	if err := itr.pushCommit(h, commit); err != nil {
+		cancel()
 		return nil, err
 	}
+	itr.head = h
 
-	return &LogItr{commits, 0}, nil
+	return itr, nil
 }
 
-// Next retrieves the next row. It will return io.EOF if it's the last row.
-// After retrieving the last row, Close will be automatically closed.
-func (itr *LogItr) Next() (sql.Row, error) {
-	if itr.idx >= len(itr.commits) {
-		return nil, io.EOF
+// commitHashEquality inspects filters for a single `commit_hash = '...'` comparison, which lets NewLogItr skip
+// setting up the time-ordered history walk; Next then looks that commit up directly.
+func commitHashEquality(filters []sql.Expression) (string, bool) {
+	for _, f := range filters {
+		eq, ok := f.(*expression.Equals)
+		if !ok {
+			continue
+		}
+
+		left, right := eq.Left(), eq.Right()
+		gf, ok := left.(*expression.GetField)
+		lit, litOk := right.(*expression.Literal)
+		if !ok || !litOk {
+			gf, ok = right.(*expression.GetField)
+			lit, litOk = left.(*expression.Literal)
+			if !ok || !litOk {
+				continue
+			}
+		}
+
+		if gf.Name() == "commit_hash" {
+			if s, ok := lit.Value().(string); ok {
+				return s, true
+			}
+		}
 	}
 
-	defer func() {
-		itr.idx++
-	}()
+	return "", false
+}
 
-	cm := itr.commits[itr.idx]
-	meta, err := cm.GetCommitMeta()
+// isAncestor reports whether target is reachable from head by following parent edges (head itself counts),
+// via a plain breadth-first walk bounded by a seen-set so merges don't cause it to revisit commits.
+func isAncestor(ctx context.Context, ddb *doltdb.DoltDB, head *doltdb.Commit, target hash.Hash) (bool, error) {
+	queue := []*doltdb.Commit{head}
+	seen := make(map[hash.Hash]bool)
+
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		cm := queue[0]
+		queue = queue[1:]
+
+		ch, err := cm.HashOf()
+		if err != nil {
+			return false, err
+		}
+
+		if seen[ch] {
+			continue
+		}
+		seen[ch] = true
+
+		if ch == target {
+			return true, nil
+		}
+
+		parents, err := cm.ParentHashes(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		for _, ph := range parents {
+			if seen[ph] {
+				continue
+			}
+
+			parent, err := ddb.ReadCommit(ph)
+			if err != nil {
+				return false, err
+			}
+			queue = append(queue, parent)
+		}
+	}
+
+	return false, nil
+}
 
+// commitHeapEntry is a single pending node in the commit walk. It carries the metadata decoded when it was
+// pushed so Next doesn't have to look it up again by way of itr.cache - that lookup would count as a "hit"
+// against a commit this same scan just decoded, understating how much of dolt_log_cache_hits reflects real
+// cross-scan reuse.
+type commitHeapEntry struct {
+	h    hash.Hash
+	cm   *doltdb.Commit
+	meta commitMetaEntry
+}
+
+// commitHeap is a container/heap.Interface ordered by commit time, most recent first.
+type commitHeap []*commitHeapEntry
+
+func (h commitHeap) Len() int            { return len(h) }
+func (h commitHeap) Less(i, j int) bool  { return h[i].meta.when.After(h[j].meta.when) }
+func (h commitHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *commitHeap) Push(x interface{}) { *h = append(*h, x.(*commitHeapEntry)) }
+func (h *commitHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+func (itr *LogItr) pushCommit(h *commitHeap, cm *doltdb.Commit) error {
+	ch, err := cm.HashOf()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	h, err := cm.HashOf()
+	if itr.seen[ch] {
+		return nil
+	}
+	itr.seen[ch] = true
 
+	meta, err := itr.metaFor(ch, cm)
 	if err != nil {
+		return err
+	}
+
+	heap.Push(h, &commitHeapEntry{h: ch, cm: cm, meta: meta})
+	return nil
+}
+
+// metaFor returns cm's decoded metadata, consulting itr.cache first so a commit visited more than once in a
+// session (or across successive dolt_log queries) only pays the noms decode cost once.
+func (itr *LogItr) metaFor(ch hash.Hash, cm *doltdb.Commit) (commitMetaEntry, error) {
+	if e, ok := itr.cache.get(ch); ok {
+		return e, nil
+	}
+
+	meta, err := cm.GetCommitMeta()
+	if err != nil {
+		return commitMetaEntry{}, err
+	}
+
+	parents, err := cm.ParentHashes(itr.ctx)
+	if err != nil {
+		return commitMetaEntry{}, err
+	}
+
+	e := commitMetaEntry{
+		name:         meta.Name,
+		email:        meta.Email,
+		description:  meta.Description,
+		when:         meta.Time(),
+		parentHashes: parents,
+	}
+	itr.cache.put(ch, e)
+
+	return e, nil
+}
+
+// Next retrieves the next row. It will return io.EOF if it's the last row.
+// After retrieving the last row, Close will be automatically closed.
+func (itr *LogItr) Next() (sql.Row, error) {
+	if err := itr.ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	return sql.NewRow(h.String(), meta.Name, meta.Email, meta.Time(), meta.Description), nil
+	if itr.commitHashEq != "" {
+		if itr.found {
+			return nil, io.EOF
+		}
+		itr.found = true
+
+		ch, ok := hash.MaybeParse(itr.commitHashEq)
+		if !ok {
+			return nil, io.EOF
+		}
+
+		cm, err := itr.ddb.ReadCommit(ch)
+		if err != nil {
+			return nil, io.EOF
+		}
+
+		// dolt_log only ever shows commits reachable from HEAD, so a commit_hash lookup that names a commit
+		// on an unrelated branch must yield nothing, same as a full scan would.
+		reachable, err := isAncestor(itr.ctx, itr.ddb, itr.headCommit, ch)
+		if err != nil {
+			return nil, err
+		}
+		if !reachable {
+			return nil, io.EOF
+		}
+
+		meta, err := itr.metaFor(ch, cm)
+		if err != nil {
+			return nil, err
+		}
+
+		return itr.rowForCommit(ch, meta), nil
+	}
+
+	for itr.head.Len() > 0 {
+		if err := itr.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		entry := heap.Pop(itr.head).(*commitHeapEntry)
+
+		for _, ph := range entry.meta.parentHashes {
+			if itr.seen[ph] {
+				continue
+			}
+
+			parent, err := itr.ddb.ReadCommit(ph)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := itr.pushCommit(itr.head, parent); err != nil {
+				return nil, err
+			}
+		}
+
+		return itr.rowForCommit(entry.h, entry.meta), nil
+	}
+
+	return nil, io.EOF
+}
+
+// rowForCommit builds the log table's row shape from a commit's already-decoded metadata.
+func (itr *LogItr) rowForCommit(ch hash.Hash, meta commitMetaEntry) sql.Row {
+	return sql.NewRow(ch.String(), meta.name, meta.email, meta.when, meta.description, parentHashesString(meta.parentHashes))
 }
 
-// Close closes the iterator.
+// parentHashesString renders a commit's parent hashes as a comma-separated list, matching the flat-text style
+// the rest of this table's columns use rather than introducing a JSON column type.
+func parentHashesString(parents []hash.Hash) string {
+	if len(parents) == 0 {
+		return ""
+	}
+
+	strs := make([]string, len(parents))
+	for i, ph := range parents {
+		strs[i] = ph.String()
+	}
+
+	return strings.Join(strs, ",")
+}
+
+// Close closes the iterator, cancelling its commit walk so any in-flight ddb reads can unwind promptly. It also
+// publishes the session's cumulative commitMetaCache hit/miss counts to its dolt_log_cache_hits and
+// dolt_log_cache_misses variables, the only way an operator can observe whether dolt_log_cache_size is actually
+// paying off without attaching a profiler.
 func (itr *LogItr) Close() error {
+	// A client disconnect or KILL QUERY cancels sqlCtx's own context before Close runs, not just the derived
+	// itr.ctx that itr.cancel() below controls. Publishing stats against an already-cancelled session in that
+	// case would turn an otherwise-successful disconnect into a reported query error, so skip it - this
+	// instrumentation is best-effort, not part of the scan's actual contract.
+	clientCancelled := itr.sqlCtx.Context.Err() != nil
+
+	itr.cancel()
+
+	if clientCancelled {
+		return nil
+	}
+
+	hits, misses := itr.cache.stats()
+	hitsErr := itr.sqlCtx.SetSessionVariable(itr.sqlCtx, DoltLogCacheHitsSessionVar, int64(hits))
+	missesErr := itr.sqlCtx.SetSessionVariable(itr.sqlCtx, DoltLogCacheMissesSessionVar, int64(misses))
+	if hitsErr != nil {
+		return hitsErr
+	}
+	if missesErr != nil {
+		return missesErr
+	}
+
 	return nil
 }
@@ -0,0 +1,127 @@
+// Copyright 2019 Liquidata, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqle
+
+import (
+	"fmt"
+
+	"github.com/liquidata-inc/go-mysql-server/sql"
+	"github.com/liquidata-inc/go-mysql-server/sql/expression"
+
+	"github.com/liquidata-inc/dolt/go/libraries/doltcore/doltdb"
+	"github.com/liquidata-inc/dolt/go/store/hash"
+)
+
+// MergeBaseFuncName is the name clients call this function by: SELECT dolt_merge_base('hashA', 'hashB').
+const MergeBaseFuncName = "dolt_merge_base"
+
+// MergeBaseFunc is the sql.Expression implementation backing dolt_merge_base(hashA, hashB). It resolves both
+// hashes against the current database's DoltDB and returns the merge-base's commit hash as text, or NULL if
+// the two commits share no ancestor.
+type MergeBaseFunc struct {
+	expression.BinaryExpression
+}
+
+// NewMergeBaseFunc creates a dolt_merge_base(hashA, hashB) expression, registered as a sql.Function2.
+func NewMergeBaseFunc(hashA, hashB sql.Expression) sql.Expression {
+	return &MergeBaseFunc{expression.BinaryExpression{Left: hashA, Right: hashB}}
+}
+
+// FunctionName implements sql.FunctionExpression
+func (mb *MergeBaseFunc) FunctionName() string {
+	return MergeBaseFuncName
+}
+
+// Type implements sql.Expression
+func (mb *MergeBaseFunc) Type() sql.Type {
+	return sql.Text
+}
+
+// String implements sql.Expression
+func (mb *MergeBaseFunc) String() string {
+	return fmt.Sprintf("%s(%s,%s)", MergeBaseFuncName, mb.Left, mb.Right)
+}
+
+// Eval implements sql.Expression
+func (mb *MergeBaseFunc) Eval(ctx *sql.Context, row sql.Row) (interface{}, error) {
+	left, err := mb.Left.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := mb.Right.Eval(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	hashA, ok := left.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected string hash, got %v", MergeBaseFuncName, left)
+	}
+
+	hashB, ok := right.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected string hash, got %v", MergeBaseFuncName, right)
+	}
+
+	dbName := ctx.GetCurrentDatabase()
+	ddb, ok := DSessFromSess(ctx.Session).GetDoltDB(dbName)
+	if !ok {
+		return nil, sql.ErrDatabaseNotFound.New(dbName)
+	}
+
+	ha, ok := hash.MaybeParse(hashA)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid commit hash %q", MergeBaseFuncName, hashA)
+	}
+
+	hb, ok := hash.MaybeParse(hashB)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid commit hash %q", MergeBaseFuncName, hashB)
+	}
+
+	cmA, err := ddb.ReadCommit(ha)
+	if err != nil {
+		return nil, err
+	}
+
+	cmB, err := ddb.ReadCommit(hb)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := MergeBase(ctx.Context, ddb, cmA, cmB)
+	if err != nil {
+		if err == doltdb.ErrCommitNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return base.String(), nil
+}
+
+// WithChildren implements sql.Expression
+func (mb *MergeBaseFunc) WithChildren(children ...sql.Expression) (sql.Expression, error) {
+	if len(children) != 2 {
+		return nil, sql.ErrInvalidChildrenNumber.New(mb, len(children), 2)
+	}
+
+	return NewMergeBaseFunc(children[0], children[1]), nil
+}